@@ -0,0 +1,73 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"runtime"
+	"sync"
+)
+
+// cacheEntry holds the parsed syntax and raw bytes for a single on-disk Go
+// file, computed at most once regardless of how many goroutines ask for it.
+type cacheEntry struct {
+	once sync.Once
+	data []byte
+	fset *token.FileSet
+	file *ast.File
+	abs  string
+	err  error
+}
+
+// fileCache memoizes, per absolute path, the syntax already produced by a
+// packageResolver plus a one-time read of the file's bytes, so concurrent
+// profile jobs never re-parse or re-read the same file.
+type fileCache struct {
+	resolver *packageResolver
+	mu       sync.Mutex
+	entries  map[string]*cacheEntry
+}
+
+func newFileCache(resolver *packageResolver) *fileCache {
+	return &fileCache{resolver: resolver, entries: make(map[string]*cacheEntry)}
+}
+
+// get resolves fileName to its on-disk entry, loading it at most once.
+func (c *fileCache) get(fileName string) (*cacheEntry, error) {
+	resolved, err := c.resolver.find(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[resolved.abs]
+	if !ok {
+		entry = &cacheEntry{}
+		c.entries[resolved.abs] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.fset = resolved.fset
+		entry.file = resolved.file
+		entry.abs = resolved.abs
+		entry.data, entry.err = ioutil.ReadFile(resolved.abs)
+	})
+	return entry, entry.err
+}
+
+// warm eagerly loads every file referenced by profiles in the background,
+// so the I/O for later files overlaps with AST work on earlier ones instead
+// of each profile job blocking on its own read. Concurrency is capped at
+// GOMAXPROCS so a profile covering thousands of files doesn't blow past the
+// process's file-descriptor limit.
+func (c *fileCache) warm(profiles []*Profile) {
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for _, profile := range profiles {
+		sem <- struct{}{}
+		go func(fileName string) {
+			defer func() { <-sem }()
+			c.get(fileName)
+		}(profile.FileName)
+	}
+}
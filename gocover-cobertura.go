@@ -2,20 +2,27 @@ package main
 
 import (
 	"encoding/xml"
+	"flag"
 	"fmt"
 	"go/ast"
-	"go/build"
-	"go/parser"
 	"go/token"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+var packagesFlag = flag.String("packages", "./...", "package patterns (space-separated) to load when resolving profile file names to their on-disk location")
+
 func main() {
+	flag.Parse()
+	if *verifyHashesFlag != "" {
+		os.Exit(verifyHashes(*verifyHashesFlag))
+	}
 	convert(os.Stdin, os.Stdout)
 }
 
@@ -25,14 +32,15 @@ func convert(in io.Reader, out io.Writer) {
 		panic("Can't parse profiles")
 	}
 
-	srcDirs := build.Default.SrcDirs()
-	sources := make([]Source, len(srcDirs))
-	for i, dir := range srcDirs {
-		sources[i] = Source{dir}
+	resolver, err := newPackageResolver(strings.Fields(*packagesFlag))
+	if err != nil {
+		panic(err)
 	}
 
-	coverage := Coverage{Sources: sources, Packages: nil, Timestamp: time.Now().UnixNano() / int64(time.Millisecond)}
-	coverage.parseProfiles(profiles)
+	coverage := Coverage{Sources: resolver.sources, Packages: nil, Timestamp: time.Now().UnixNano() / int64(time.Millisecond)}
+	if err := coverage.parseProfiles(profiles, resolver); err != nil {
+		panic(err)
+	}
 
 	fmt.Fprintf(out, xml.Header)
 	fmt.Fprintf(out, "<!DOCTYPE coverage SYSTEM \"http://cobertura.sourceforge.net/xml/coverage-03.dtd\">\n")
@@ -47,71 +55,136 @@ func convert(in io.Reader, out io.Writer) {
 	fmt.Fprintln(out)
 }
 
-func (cov *Coverage) parseProfiles(profiles []*Profile) error {
+func (cov *Coverage) parseProfiles(profiles []*Profile, resolver *packageResolver) error {
 	cov.Packages = []Package{}
+	cache := newFileCache(resolver)
+	cache.warm(profiles)
+
+	jobs := make(chan *Profile)
+	errs := make(chan error, len(profiles))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for profile := range jobs {
+				if err := cov.parseFile(cache, profile, &mu); err != nil {
+					errs <- fmt.Errorf("%s: %v", profile.FileName, err)
+				}
+			}
+		}()
+	}
 	for _, profile := range profiles {
-		cov.parseFile(profile.FileName)
+		jobs <- profile
 	}
-	return nil
-}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		return err
+	}
+
+	sort.Slice(cov.Packages, func(i, j int) bool { return cov.Packages[i].Name < cov.Packages[j].Name })
+	for i := range cov.Packages {
+		classes := cov.Packages[i].Classes
+		sort.Slice(classes, func(a, b int) bool { return classes[a].Name < classes[b].Name })
+	}
+
+	cov.updateRates()
 
-func (cov *Coverage) parseFile(fileName string) error {
-	absFilePath, err := findFile(fileName)
+	sourcesHash, err := hashSources(cov.Packages)
 	if err != nil {
 		return err
 	}
-	fset := token.NewFileSet()
-	parsed, err := parser.ParseFile(fset, absFilePath, nil, 0)
+	cov.SourcesHash = sourcesHash
+	return nil
+}
+
+func (cov *Coverage) parseFile(cache *fileCache, profile *Profile, mu *sync.Mutex) error {
+	if ignorePatternsFlag.matches(profile.FileName) {
+		return nil
+	}
+
+	entry, err := cache.get(profile.FileName)
 	if err != nil {
 		return err
 	}
-	data, err := ioutil.ReadFile(absFilePath)
+	if ignoreFileDirective(entry.file) || (!*includeGeneratedFlag && isGeneratedFile(entry.file)) {
+		return nil
+	}
+	fileHash, err := hashFile(profile.FileName, entry.data)
 	if err != nil {
 		return err
 	}
 
-	pkgPath, _ := filepath.Split(fileName)
+	pkgPath, _ := filepath.Split(profile.FileName)
 	pkgPath = strings.TrimRight(pkgPath, string(os.PathSeparator))
 
+	visitor := &fileVisitor{
+		fset:    entry.fset,
+		name:    profile.FileName,
+		astFile: entry.file,
+		classes: make(map[string]*Class),
+		data:    entry.data,
+		blocks:  profile.Blocks,
+		ignored: ignoreRanges(entry.fset, entry.file),
+	}
+	ast.Walk(visitor, visitor.astFile)
+
+	mu.Lock()
+	defer mu.Unlock()
 	var pkg *Package
-	for _, p := range cov.Packages {
-		if p.Name == pkgPath {
-			pkg = &p
+	for i := range cov.Packages {
+		if cov.Packages[i].Name == pkgPath {
+			pkg = &cov.Packages[i]
 		}
 	}
 	if pkg == nil {
-		pkg = &Package{Name: pkgPath, Classes: []Class{}}
+		cov.Packages = append(cov.Packages, Package{Name: pkgPath, Classes: []Class{}, dir: filepath.Dir(entry.abs)})
+		pkg = &cov.Packages[len(cov.Packages)-1]
 	}
-	visitor := &fileVisitor{
-		fset:     fset,
-		name:     fileName,
-		astFile:  parsed,
-		coverage: cov,
-		classes:  make(map[string]*Class),
-		pkg:      pkg,
-		data:     data,
-	}
-	ast.Walk(visitor, visitor.astFile)
 	for _, c := range visitor.classes {
+		c.LineRate, c.BranchRate = lineRates(c.Lines)
+		c.Hash = fileHash
 		pkg.Classes = append(pkg.Classes, *c)
 	}
-	cov.Packages = append(cov.Packages, *pkg)
 	return nil
 }
 
+// updateRates recomputes LineRate/BranchRate on every Package and on the
+// Coverage itself from their Classes' already-computed Lines, following the
+// standard Cobertura covered/total formula.
+func (cov *Coverage) updateRates() {
+	var allLines []Line
+	for i := range cov.Packages {
+		pkg := &cov.Packages[i]
+		var pkgLines []Line
+		for _, c := range pkg.Classes {
+			pkgLines = append(pkgLines, c.Lines...)
+		}
+		pkg.LineRate, pkg.BranchRate = lineRates(pkgLines)
+		allLines = append(allLines, pkgLines...)
+	}
+	cov.LineRate, cov.BranchRate = lineRates(allLines)
+}
+
 type fileVisitor struct {
-	fset     *token.FileSet
-	name     string
-	astFile  *ast.File
-	coverage *Coverage
-	classes  map[string]*Class
-	pkg      *Package
-	data     []byte
+	fset    *token.FileSet
+	name    string
+	astFile *ast.File
+	classes map[string]*Class
+	data    []byte
+	blocks  []ProfileBlock
+	ignored [][2]int
 }
 
 func (v *fileVisitor) Visit(node ast.Node) ast.Visitor {
 	switch n := node.(type) {
 	case *ast.FuncDecl:
+		if ignoreNextDirective(n.Doc) {
+			return v
+		}
 		class := v.class(n)
 		method := v.method(n)
 		class.Methods = append(class.Methods, *method)
@@ -124,10 +197,136 @@ func (v *fileVisitor) Visit(node ast.Node) ast.Visitor {
 
 func (v *fileVisitor) method(n *ast.FuncDecl) *Method {
 	method := &Method{Name: n.Name.Name}
-	method.Lines = []Line{}
+	start := v.fset.Position(n.Pos()).Line
+	end := v.fset.Position(n.End()).Line
+	method.Lines = v.linesInRange(n, start, end)
+	method.LineRate, method.BranchRate = lineRates(method.Lines)
 	return method
 }
 
+// linesInRange emits one Line per source line in [start, end] that a
+// profile block overlaps, with Hits taken from the highest-count block
+// covering that line, plus branch/condition-coverage data for lines that
+// open a conditional statement.
+func (v *fileVisitor) linesInRange(n ast.Node, start, end int) []Line {
+	lines := []Line{}
+	for lineNo := start; lineNo <= end; lineNo++ {
+		if inIgnoreRange(v.ignored, lineNo) {
+			continue
+		}
+		blocks := v.blocksAtLine(lineNo)
+		if len(blocks) == 0 {
+			continue
+		}
+		hits := 0
+		for _, b := range blocks {
+			if b.Count > hits {
+				hits = b.Count
+			}
+		}
+		line := Line{Number: lineNo, Hits: hits}
+		if cond := v.conditionalAt(n, lineNo); cond != nil {
+			if covered, total := v.branchCoverage(cond); total > 0 {
+				line.Branch = true
+				line.ConditionCoverage = fmt.Sprintf("%d%% (%d/%d)", percentage(covered, total), covered, total)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (v *fileVisitor) blocksAtLine(lineNo int) []ProfileBlock {
+	var found []ProfileBlock
+	for _, b := range v.blocks {
+		if lineNo >= b.StartLine && lineNo <= b.EndLine {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+// conditionalAt returns the *ast.IfStmt, *ast.SwitchStmt or *ast.CaseClause
+// that starts at lineNo within n, if any.
+func (v *fileVisitor) conditionalAt(n ast.Node, lineNo int) ast.Node {
+	var found ast.Node
+	ast.Inspect(n, func(node ast.Node) bool {
+		if found != nil || node == nil {
+			return false
+		}
+		switch node.(type) {
+		case *ast.IfStmt, *ast.SwitchStmt, *ast.CaseClause:
+			if v.fset.Position(node.Pos()).Line == lineNo {
+				found = node
+				return false
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// branchCoverage reports how many of the profile blocks starting inside
+// cond's body were hit at least once, out of how many there are. Blocks
+// are compared by (line, column) rather than line alone, since a
+// single-line conditional (e.g. "if x { y }") has its body start on the
+// same line as cond itself.
+func (v *fileVisitor) branchCoverage(cond ast.Node) (covered, total int) {
+	start := v.fset.Position(cond.Pos())
+	end := v.fset.Position(cond.End())
+	for _, b := range v.blocks {
+		if posAfter(b.StartLine, b.StartCol, start.Line, start.Column) &&
+			posAfter(end.Line, end.Column, b.StartLine, b.StartCol) {
+			total++
+			if b.Count > 0 {
+				covered++
+			}
+		}
+	}
+	return covered, total
+}
+
+// posAfter reports whether (line, col) comes strictly after (afterLine,
+// afterCol).
+func posAfter(line, col, afterLine, afterCol int) bool {
+	if line != afterLine {
+		return line > afterLine
+	}
+	return col > afterCol
+}
+
+func percentage(covered, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return covered * 100 / total
+}
+
+// lineRates computes the line- and branch-coverage rate for a slice of
+// Lines using the standard Cobertura covered/total formula.
+func lineRates(lines []Line) (lineRate, branchRate float32) {
+	var coveredLines, branches, coveredBranches int
+	for _, l := range lines {
+		if l.Hits > 0 {
+			coveredLines++
+		}
+		if l.Branch {
+			branches++
+			if l.Hits > 0 {
+				coveredBranches++
+			}
+		}
+	}
+	return rate(coveredLines, len(lines)), rate(coveredBranches, branches)
+}
+
+func rate(covered, total int) float32 {
+	if total == 0 {
+		return 0
+	}
+	return float32(covered) / float32(total)
+}
+
 func (v *fileVisitor) class(n *ast.FuncDecl) *Class {
 	className := v.recvName(n)
 	var class *Class = v.classes[className]
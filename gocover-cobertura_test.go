@@ -0,0 +1,144 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+const sampleSrc = `package sample
+
+func Add(a, b int) int {
+	if a > b {
+		return a + b
+	}
+	return a - b
+}
+`
+
+// TestMethodLinesAndRates feeds a hand-built []ProfileBlock for a known
+// source file directly to fileVisitor (bypassing package loading) and
+// asserts the resulting Line hits and LineRate/BranchRate.
+func TestMethodLinesAndRates(t *testing.T) {
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, "sample.go", sampleSrc, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fn *ast.FuncDecl
+	var ifStmt *ast.IfStmt
+	ast.Inspect(astFile, func(n ast.Node) bool {
+		switch d := n.(type) {
+		case *ast.FuncDecl:
+			fn = d
+		case *ast.IfStmt:
+			ifStmt = d
+		}
+		return true
+	})
+	if fn == nil || ifStmt == nil {
+		t.Fatal("fixture didn't parse into the expected shape")
+	}
+
+	pos := func(p token.Pos) (int, int) {
+		position := fset.Position(p)
+		return position.Line, position.Column
+	}
+	bodyStartLine, bodyStartCol := pos(fn.Body.Lbrace + 1)
+	ifBodyStartLine, ifBodyStartCol := pos(ifStmt.Body.Lbrace + 1)
+	ifEndLine, ifEndCol := pos(ifStmt.End())
+	funcEndLine, funcEndCol := pos(fn.Body.Rbrace)
+
+	// Three blocks, as "go test -coverprofile" would emit them: the
+	// function's entry up to the if, the if's (taken) true branch, and
+	// the (never taken) statement following it.
+	blocks := []ProfileBlock{
+		{StartLine: bodyStartLine, StartCol: bodyStartCol, EndLine: ifBodyStartLine, EndCol: ifBodyStartCol, NumStmt: 1, Count: 1},
+		{StartLine: ifBodyStartLine, StartCol: ifBodyStartCol, EndLine: ifEndLine, EndCol: ifEndCol, NumStmt: 1, Count: 1},
+		{StartLine: ifEndLine, StartCol: ifEndCol, EndLine: funcEndLine, EndCol: funcEndCol, NumStmt: 1, Count: 0},
+	}
+
+	v := &fileVisitor{fset: fset, name: "sample.go", blocks: blocks, classes: make(map[string]*Class)}
+	method := v.method(fn)
+
+	hits := make(map[int]int)
+	var ifLine *Line
+	for i, l := range method.Lines {
+		hits[l.Number] = l.Hits
+		if l.Number == 4 {
+			ifLine = &method.Lines[i]
+		}
+	}
+
+	if hits[5] != 1 {
+		t.Errorf("line 5 (return a + b, inside the taken if): got %d hits, want 1", hits[5])
+	}
+	if hits[7] != 0 {
+		t.Errorf("line 7 (return a - b, never reached): got %d hits, want 0", hits[7])
+	}
+
+	if ifLine == nil || !ifLine.Branch {
+		t.Fatalf("expected line 4 (the if) to be marked as a branch, got %+v", method.Lines)
+	}
+	if want := "100% (1/1)"; ifLine.ConditionCoverage != want {
+		t.Errorf("condition-coverage = %q, want %q", ifLine.ConditionCoverage, want)
+	}
+
+	// Lines 3-8 all have block data; 3, 4, 5 and 6 were hit, 7 and 8 weren't: 4/6.
+	if want := rate(4, 6); method.LineRate != want {
+		t.Errorf("LineRate = %v, want %v", method.LineRate, want)
+	}
+	// The only branch (line 4) was fully covered: 1/1.
+	if want := rate(1, 1); method.BranchRate != want {
+		t.Errorf("BranchRate = %v, want %v", method.BranchRate, want)
+	}
+}
+
+// TestBranchCoverageExcludesSingleLineConditional reproduces a one-line
+// conditional, whose body opens and closes on the same line as the if
+// itself, and checks it isn't reported as a branch with a fabricated
+// denominator when the profile has no sub-block for it.
+func TestBranchCoverageExcludesSingleLineConditional(t *testing.T) {
+	const src = `package sample
+
+func Abs(x int) int {
+	if x < 0 { x = -x }
+	return x
+}
+`
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, "sample.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fn *ast.FuncDecl
+	ast.Inspect(astFile, func(n ast.Node) bool {
+		if d, ok := n.(*ast.FuncDecl); ok {
+			fn = d
+		}
+		return true
+	})
+
+	// A single block spanning the whole function body, as go's cover tool
+	// emits when a conditional doesn't fork into its own counted block.
+	pos := func(p token.Pos) (int, int) {
+		position := fset.Position(p)
+		return position.Line, position.Column
+	}
+	startLine, startCol := pos(fn.Body.Lbrace + 1)
+	endLine, endCol := pos(fn.Body.Rbrace)
+	blocks := []ProfileBlock{
+		{StartLine: startLine, StartCol: startCol, EndLine: endLine, EndCol: endCol, NumStmt: 2, Count: 1},
+	}
+
+	v := &fileVisitor{fset: fset, name: "sample.go", blocks: blocks, classes: make(map[string]*Class)}
+	method := v.method(fn)
+
+	for _, l := range method.Lines {
+		if l.Number == 4 && l.Branch {
+			t.Errorf("line 4 (a single-line if with no sub-blocks) should not be marked as a branch, got %+v", l)
+		}
+	}
+}
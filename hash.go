@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+var verifyHashesFlag = flag.String("verify-hashes", "", "re-hash the working tree against a previously generated Cobertura report and exit 2 on drift")
+
+// hashFile returns the dirhash h1: digest of a single file's already-loaded
+// contents, without touching disk again.
+func hashFile(path string, data []byte) (string, error) {
+	return dirhash.Hash1([]string{path}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+// hashSources fills in Package.Hash for every package (an h1: digest of its
+// on-disk directory) and returns the top-level sources-hash: an h1: digest
+// over every class's file path and the per-file hash already computed for
+// it, so a report can be matched back to the exact tree it came from.
+func hashSources(packages []Package) (string, error) {
+	type pathHash struct {
+		path, hash string
+	}
+	var all []pathHash
+	for i := range packages {
+		pkg := &packages[i]
+		if pkg.dir != "" {
+			hash, err := dirhash.HashDir(pkg.dir, pkg.Name, dirhash.Hash1)
+			if err != nil {
+				return "", err
+			}
+			pkg.Hash = hash
+		}
+		for _, c := range pkg.Classes {
+			all = append(all, pathHash{path: c.Filename, hash: c.Hash})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].path < all[j].path })
+
+	files := make([]string, len(all))
+	content := make(map[string]string, len(all))
+	for i, ph := range all {
+		files[i] = ph.path
+		content[ph.path] = ph.hash
+	}
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(content[name])), nil
+	})
+}
+
+// verifyHashes re-hashes the working tree named by -packages against the
+// Class hashes recorded in the report at reportPath, printing every file
+// whose hash no longer matches. It returns the process exit code: 0 when
+// the tree matches the report, 2 on any drift or error.
+func verifyHashes(reportPath string) int {
+	data, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	var report Coverage
+	if err := xml.Unmarshal(data, &report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	resolver, err := newPackageResolver(strings.Fields(*packagesFlag))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	drift := false
+	for _, pkg := range report.Packages {
+		for _, class := range pkg.Classes {
+			resolved, err := resolver.find(class.Filename)
+			if err != nil {
+				fmt.Printf("%s: %v\n", class.Filename, err)
+				drift = true
+				continue
+			}
+			data, err := ioutil.ReadFile(resolved.abs)
+			if err != nil {
+				fmt.Printf("%s: %v\n", class.Filename, err)
+				drift = true
+				continue
+			}
+			got, err := hashFile(class.Filename, data)
+			if err != nil || got != class.Hash {
+				fmt.Printf("%s: report has %s, working tree has %s\n", class.Filename, class.Hash, got)
+				drift = true
+			}
+		}
+	}
+	if drift {
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var includeGeneratedFlag = flag.Bool("include-generated", false, `include files whose leading comment matches the stdlib "Code generated ... DO NOT EDIT." convention`)
+
+var ignorePatternsFlag ignorePatterns
+
+func init() {
+	flag.Var(&ignorePatternsFlag, "ignore-pattern", "glob (repeatable) matched against a profile's file name to exclude it from the report")
+}
+
+// ignorePatterns collects repeated -ignore-pattern flag values.
+type ignorePatterns []string
+
+func (p *ignorePatterns) String() string { return strings.Join(*p, ",") }
+
+func (p *ignorePatterns) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// matches reports whether fileName (always "/"-separated, as profile file
+// names are) matches any pattern, either in full or by its base name alone
+// - so a pattern like "mock_*.go" excludes "pkg/foo/mock_x.go" without
+// having to span the directory separator, which "*" never does.
+func (p ignorePatterns) matches(fileName string) bool {
+	base := path.Base(fileName)
+	for _, pattern := range p {
+		if ok, _ := path.Match(pattern, fileName); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var generatedCodePattern = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGeneratedFile reports whether astFile's leading comment matches the
+// stdlib "Code generated ... DO NOT EDIT." convention.
+func isGeneratedFile(astFile *ast.File) bool {
+	if len(astFile.Comments) == 0 {
+		return false
+	}
+	first := astFile.Comments[0]
+	if first.Pos() > astFile.Package {
+		return false
+	}
+	for _, c := range first.List {
+		if generatedCodePattern.MatchString(strings.TrimRight(c.Text, "\r")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreNextDirective reports whether doc is a //coverage:ignore next
+// comment placed directly above a declaration to skip.
+func ignoreNextDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == "//coverage:ignore next" {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreFileDirective reports whether astFile's leading comment group
+// contains a //coverage:ignore file directive, excluding the whole file.
+func ignoreFileDirective(astFile *ast.File) bool {
+	if len(astFile.Comments) == 0 {
+		return false
+	}
+	first := astFile.Comments[0]
+	if first.Pos() > astFile.Package {
+		return false
+	}
+	for _, c := range first.List {
+		if strings.TrimSpace(c.Text) == "//coverage:ignore file" {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreRanges collects every //coverage:ignore start / //coverage:ignore
+// end bracketed pair in astFile as inclusive [start, end] source line
+// ranges whose statements should be dropped from coverage.
+func ignoreRanges(fset *token.FileSet, astFile *ast.File) [][2]int {
+	var ranges [][2]int
+	var start int
+	for _, group := range astFile.Comments {
+		for _, c := range group.List {
+			switch strings.TrimSpace(c.Text) {
+			case "//coverage:ignore start":
+				start = fset.Position(c.End()).Line + 1
+			case "//coverage:ignore end":
+				if start != 0 {
+					ranges = append(ranges, [2]int{start, fset.Position(c.Pos()).Line - 1})
+					start = 0
+				}
+			}
+		}
+	}
+	return ranges
+}
+
+// inIgnoreRange reports whether line falls inside any bracketed
+// //coverage:ignore start/end range.
+func inIgnoreRange(ranges [][2]int, line int) bool {
+	for _, r := range ranges {
+		if line >= r[0] && line <= r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func parseSample(t *testing.T, src string) (*token.FileSet, *ast.File) {
+	t.Helper()
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, "sample.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fset, astFile
+}
+
+func TestIgnoreFileDirective(t *testing.T) {
+	_, ignored := parseSample(t, "//coverage:ignore file\npackage sample\n")
+	if !ignoreFileDirective(ignored) {
+		t.Error("expected //coverage:ignore file to be detected")
+	}
+
+	_, notIgnored := parseSample(t, "// just a normal doc comment\npackage sample\n")
+	if ignoreFileDirective(notIgnored) {
+		t.Error("a plain leading comment should not be treated as //coverage:ignore file")
+	}
+}
+
+func TestIsGeneratedFile(t *testing.T) {
+	_, generated := parseSample(t, "// Code generated by protoc-gen-go. DO NOT EDIT.\npackage sample\n")
+	if !isGeneratedFile(generated) {
+		t.Error("expected the stdlib \"Code generated ... DO NOT EDIT.\" convention to be detected")
+	}
+
+	_, handwritten := parseSample(t, "// Package sample does things.\npackage sample\n")
+	if isGeneratedFile(handwritten) {
+		t.Error("a normal package doc comment should not be treated as generated")
+	}
+}
+
+func TestIgnoreNextDirectiveSkipsFunc(t *testing.T) {
+	const src = `package sample
+
+//coverage:ignore next
+func Skip() int {
+	return 1
+}
+
+func Keep() int {
+	return 2
+}
+`
+	fset, astFile := parseSample(t, src)
+
+	v := &fileVisitor{fset: fset, name: "sample.go", classes: make(map[string]*Class)}
+	ast.Walk(v, astFile)
+
+	class := v.classes["-"]
+	if class == nil {
+		t.Fatal("expected a \"-\" class for the free functions")
+	}
+	if len(class.Methods) != 1 || class.Methods[0].Name != "Keep" {
+		t.Errorf("expected only Keep to be recorded, got %+v", class.Methods)
+	}
+}
+
+func TestIgnoreRangeShrinksDenominator(t *testing.T) {
+	const src = `package sample
+
+func Calc() int {
+	x := 1
+	//coverage:ignore start
+	x = x + 100
+	//coverage:ignore end
+	return x
+}
+`
+	fset, astFile := parseSample(t, src)
+	var fn *ast.FuncDecl
+	ast.Inspect(astFile, func(n ast.Node) bool {
+		if d, ok := n.(*ast.FuncDecl); ok {
+			fn = d
+		}
+		return true
+	})
+	if fn == nil {
+		t.Fatal("fixture didn't parse into the expected shape")
+	}
+
+	ranges := ignoreRanges(fset, astFile)
+	if len(ranges) != 1 {
+		t.Fatalf("expected exactly one ignored range, got %v", ranges)
+	}
+
+	startLine := fset.Position(fn.Pos()).Line
+	endLine := fset.Position(fn.End()).Line
+	blocks := []ProfileBlock{
+		{StartLine: startLine, StartCol: 1, EndLine: endLine, EndCol: 1, NumStmt: 3, Count: 1},
+	}
+
+	withoutIgnore := (&fileVisitor{fset: fset, blocks: blocks}).linesInRange(fn, startLine, endLine)
+	withIgnore := (&fileVisitor{fset: fset, blocks: blocks, ignored: ranges}).linesInRange(fn, startLine, endLine)
+
+	if len(withIgnore) != len(withoutIgnore)-1 {
+		t.Errorf("expected the bracketed line to shrink the denominator by exactly one line, got %d lines (was %d without the directive)", len(withIgnore), len(withoutIgnore))
+	}
+	for _, l := range withIgnore {
+		if l.Number == 6 {
+			t.Errorf("line 6 is bracketed by //coverage:ignore start/end and should have been dropped, got %+v", withIgnore)
+		}
+	}
+}
+
+func TestIgnorePatternsMatchesBaseNameAndFullPath(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		fileName string
+		want     bool
+	}{
+		{[]string{"mock_*.go"}, "pkg/foo/mock_client.go", true},
+		{[]string{"mock_*.go"}, "pkg/foo/client.go", false},
+		{[]string{"pkg/foo/*.go"}, "pkg/foo/client.go", true},
+		{[]string{"pkg/foo/*.go"}, "pkg/bar/client.go", false},
+	}
+	for _, c := range cases {
+		p := ignorePatterns(c.patterns)
+		if got := p.matches(c.fileName); got != c.want {
+			t.Errorf("ignorePatterns(%v).matches(%q) = %v, want %v", c.patterns, c.fileName, got, c.want)
+		}
+	}
+}
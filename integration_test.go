@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestConvertPipelineEndToEnd exercises the real parseProfiles/parseFile
+// pipeline through a packageResolver loaded via go/packages (rather than a
+// hand-built token.FileSet, as the other tests use), so a mistake like a
+// nil pkg.Fset or a swallowed pipeline error shows up here instead of only
+// in a real run against a real profile.
+func TestConvertPipelineEndToEnd(t *testing.T) {
+	resolver, err := newPackageResolver([]string{"."})
+	if err != nil {
+		t.Fatalf("newPackageResolver: %v", err)
+	}
+	if len(resolver.files) == 0 {
+		t.Fatal("resolver didn't index any files from this module")
+	}
+
+	// percentage() lives at gocover-cobertura.go:298-303 in this module.
+	const profileText = `mode: count
+github.com/lewohart/gocover-cobertura/gocover-cobertura.go:298.34,303.2 3 1
+`
+	profiles, err := ParseProfiles(strings.NewReader(profileText))
+	if err != nil {
+		t.Fatalf("ParseProfiles: %v", err)
+	}
+
+	var cov Coverage
+	if err := cov.parseProfiles(profiles, resolver); err != nil {
+		t.Fatalf("parseProfiles: %v", err)
+	}
+
+	if len(cov.Packages) == 0 {
+		t.Fatal("expected at least one package in the report, got none")
+	}
+
+	var found bool
+	for _, pkg := range cov.Packages {
+		for _, class := range pkg.Classes {
+			for _, m := range class.Methods {
+				if m.Name == "percentage" && len(m.Lines) > 0 {
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("expected percentage() to show up with non-empty Lines, got none")
+	}
+}
+
+// TestConvertPipelineFailsLoudlyOnMissingFile reproduces a profile naming a
+// file the resolver never loaded (e.g. the wrong -packages was given): the
+// pipeline must return an error rather than silently producing an empty
+// report.
+func TestConvertPipelineFailsLoudlyOnMissingFile(t *testing.T) {
+	resolver, err := newPackageResolver([]string{"."})
+	if err != nil {
+		t.Fatalf("newPackageResolver: %v", err)
+	}
+
+	const profileText = `mode: count
+github.com/lewohart/gocover-cobertura/does_not_exist.go:1.1,2.1 1 1
+`
+	profiles, err := ParseProfiles(strings.NewReader(profileText))
+	if err != nil {
+		t.Fatalf("ParseProfiles: %v", err)
+	}
+
+	var cov Coverage
+	if err := cov.parseProfiles(profiles, resolver); err == nil {
+		t.Error("expected an error for a profile naming a file outside the loaded packages, got nil")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// resolvedFile is a single Go file discovered by a packageResolver, together
+// with the parsed syntax produced by the one-shot packages.Load call that
+// found it, so callers never need to re-parse it.
+type resolvedFile struct {
+	fset *token.FileSet
+	file *ast.File
+	abs  string
+}
+
+// packageResolver maps profile-style file names (import path + base name, as
+// emitted in a coverage profile) to their on-disk location, loaded once via
+// golang.org/x/tools/go/packages instead of walking build.Default.SrcDirs().
+type packageResolver struct {
+	files   map[string]resolvedFile
+	sources []Source
+}
+
+// newPackageResolver loads the packages matching patterns and indexes their
+// compiled Go files for lookup by profile path.
+func newPackageResolver(patterns []string) (*packageResolver, error) {
+	cfg := &packages.Config{
+		// NeedTypes is required even though we never look at pkg.Types: it's
+		// the mode bit that makes the loader populate pkg.Fset. Without it
+		// pkg.Fset is nil and every fset.Position call on the resulting
+		// syntax panics.
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedSyntax | packages.NeedTypes,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("loading packages %v: %v", patterns, err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return nil, fmt.Errorf("loading packages %v: one or more packages failed to load", patterns)
+	}
+
+	r := &packageResolver{files: make(map[string]resolvedFile)}
+	seenDirs := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for i, goFile := range pkg.CompiledGoFiles {
+			// Profile file names and import paths are always "/"-separated,
+			// regardless of host OS, so build the key with path.Join rather
+			// than filepath.Join.
+			key := path.Join(pkg.PkgPath, filepath.Base(goFile))
+			r.files[key] = resolvedFile{fset: pkg.Fset, file: pkg.Syntax[i], abs: goFile}
+		}
+		if dir := moduleDir(pkg); dir != "" && !seenDirs[dir] {
+			seenDirs[dir] = true
+			r.sources = append(r.sources, Source{dir})
+		}
+	}
+	return r, nil
+}
+
+var gomodDirOnce struct {
+	sync.Once
+	dir string
+}
+
+// goModDir returns the directory of the module `go env GOMOD` resolves from
+// the current working directory, computed at most once per run.
+func goModDir() string {
+	gomodDirOnce.Do(func() {
+		out, err := exec.Command("go", "env", "GOMOD").Output()
+		if err != nil {
+			return
+		}
+		gomod := strings.TrimSpace(string(out))
+		if gomod == "" || gomod == os.DevNull {
+			return
+		}
+		gomodDirOnce.dir = filepath.Dir(gomod)
+	})
+	return gomodDirOnce.dir
+}
+
+// moduleDir returns the root directory to report as a Cobertura <source> for
+// pkg: its module directory when it has one, otherwise goModDir().
+func moduleDir(pkg *packages.Package) string {
+	if pkg.Module != nil && pkg.Module.Dir != "" {
+		return pkg.Module.Dir
+	}
+	return goModDir()
+}
+
+// find looks up the on-disk file and parsed syntax for a profile-style file
+// name, as previously indexed by newPackageResolver.
+func (r *packageResolver) find(fileName string) (resolvedFile, error) {
+	resolved, ok := r.files[fileName]
+	if !ok {
+		return resolvedFile{}, fmt.Errorf("can't find %q among loaded packages", fileName)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Profile is the coverage data for a single source file, as emitted by
+// `go test -coverprofile`.
+type Profile struct {
+	FileName string
+	Mode     string
+	Blocks   []ProfileBlock
+}
+
+// ProfileBlock is a single block of profiling data, one line of a coverage
+// profile.
+type ProfileBlock struct {
+	StartLine, StartCol int
+	EndLine, EndCol     int
+	NumStmt, Count      int
+}
+
+// ParseProfiles parses a coverage profile read from in, returning one
+// Profile per source file it describes, in first-seen order.
+func ParseProfiles(in io.Reader) ([]*Profile, error) {
+	files := make(map[string]*Profile)
+	var order []string
+
+	s := bufio.NewScanner(in)
+	mode := ""
+	for s.Scan() {
+		line := s.Text()
+		if mode == "" {
+			const p = "mode: "
+			if !strings.HasPrefix(line, p) || line == p {
+				return nil, fmt.Errorf("bad mode line: %v", line)
+			}
+			mode = line[len(p):]
+			continue
+		}
+		fileName, block, err := parseProfileLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %q doesn't match expected format: %v", line, err)
+		}
+		profile := files[fileName]
+		if profile == nil {
+			profile = &Profile{FileName: fileName, Mode: mode}
+			files[fileName] = profile
+			order = append(order, fileName)
+		}
+		profile.Blocks = append(profile.Blocks, block)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*Profile, 0, len(order))
+	for _, fileName := range order {
+		profiles = append(profiles, files[fileName])
+	}
+	return profiles, nil
+}
+
+// parseProfileLine parses a single line of a coverage profile, e.g.
+// "encoding/base64/base64.go:34.44,37.40 3 1".
+func parseProfileLine(line string) (string, ProfileBlock, error) {
+	sep := strings.LastIndex(line, ":")
+	if sep == -1 {
+		return "", ProfileBlock{}, fmt.Errorf("missing ':'")
+	}
+	fileName := line[:sep]
+
+	var b ProfileBlock
+	_, err := fmt.Sscanf(line[sep+1:], "%d.%d,%d.%d %d %d",
+		&b.StartLine, &b.StartCol, &b.EndLine, &b.EndCol, &b.NumStmt, &b.Count)
+	if err != nil {
+		return "", ProfileBlock{}, err
+	}
+	return fileName, b, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import "encoding/xml"
+
+// Coverage is the root of the Cobertura XML report.
+type Coverage struct {
+	XMLName     xml.Name  `xml:"coverage"`
+	LineRate    float32   `xml:"line-rate,attr"`
+	BranchRate  float32   `xml:"branch-rate,attr"`
+	Timestamp   int64     `xml:"timestamp,attr"`
+	SourcesHash string    `xml:"sources-hash,omitempty"`
+	Sources     []Source  `xml:"sources>source"`
+	Packages    []Package `xml:"packages>package"`
+}
+
+// Source is a single root directory Cobertura should resolve Class
+// filenames against.
+type Source struct {
+	Path string `xml:",chardata"`
+}
+
+// Package groups the Classes found in one directory (one Go import path).
+type Package struct {
+	Name       string  `xml:"name,attr"`
+	LineRate   float32 `xml:"line-rate,attr"`
+	BranchRate float32 `xml:"branch-rate,attr"`
+	Hash       string  `xml:"hash,attr,omitempty"`
+	Classes    []Class `xml:"classes>class"`
+
+	// dir is the package's absolute directory on disk, used to compute
+	// Hash; it isn't part of the XML schema.
+	dir string
+}
+
+// Class is, despite the name, one Go file/receiver pairing: "-" for
+// free functions, the receiver type name for methods.
+type Class struct {
+	Name       string   `xml:"name,attr"`
+	Filename   string   `xml:"filename,attr"`
+	LineRate   float32  `xml:"line-rate,attr"`
+	BranchRate float32  `xml:"branch-rate,attr"`
+	Hash       string   `xml:"hash,attr,omitempty"`
+	Methods    []Method `xml:"methods>method"`
+	Lines      []Line   `xml:"lines>line"`
+}
+
+// Method is a single function or method declaration.
+type Method struct {
+	Name       string  `xml:"name,attr"`
+	LineRate   float32 `xml:"line-rate,attr"`
+	BranchRate float32 `xml:"branch-rate,attr"`
+	Lines      []Line  `xml:"lines>line"`
+}
+
+// Line is one covered source line.
+type Line struct {
+	Number            int    `xml:"number,attr"`
+	Hits              int    `xml:"hits,attr"`
+	Branch            bool   `xml:"branch,attr,omitempty"`
+	ConditionCoverage string `xml:"condition-coverage,attr,omitempty"`
+}